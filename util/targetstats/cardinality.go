@@ -0,0 +1,167 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package targetstats
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultCardinalityThreshold is the cartesian product of label values above
+// which a family is reported as a high-cardinality "worst offender".
+const DefaultCardinalityThreshold = 1000
+
+// DefaultTopK is the number of worst-offending families reported when
+// Options.TopK is left unset.
+const DefaultTopK = 10
+
+// Options configures an Analyze call.
+type Options struct {
+	// SortBy orders the TargetStat slices, either "value" or "name".
+	SortBy string
+	// Threshold is the label-value cartesian product above which a family
+	// is considered a high-cardinality offender. Defaults to
+	// DefaultCardinalityThreshold when zero.
+	Threshold int
+	// TopK bounds how many offenders are reported. Defaults to DefaultTopK
+	// when zero.
+	TopK int
+}
+
+func (o Options) threshold() int {
+	if o.Threshold > 0 {
+		return o.Threshold
+	}
+	return DefaultCardinalityThreshold
+}
+
+func (o Options) topK() int {
+	if o.TopK > 0 {
+		return o.TopK
+	}
+	return DefaultTopK
+}
+
+// LabelStat reports, for a single label name seen across the target, how
+// widely it is used and how many distinct values it takes on.
+type LabelStat struct {
+	Name           string
+	FamilyCount    int
+	DistinctValues int
+	TopFamilies    []string
+}
+
+// Offender reports a metric family whose label values, taken together,
+// produce a label-set cardinality above the configured threshold.
+type Offender struct {
+	Family      string
+	Cardinality uint64
+}
+
+// labelMeta accumulates, for a single label name, the set of distinct values
+// seen and which families contribute them.
+type labelMeta struct {
+	values       map[string]struct{}
+	familyCounts map[string]int
+}
+
+func newLabelMeta() *labelMeta {
+	return &labelMeta{
+		values:       make(map[string]struct{}),
+		familyCounts: make(map[string]int),
+	}
+}
+
+// cardinality returns the cartesian product of per-label distinct value
+// counts recorded on f, i.e. the worst-case number of label-sets the family
+// could produce. The product saturates at math.MaxUint64 instead of
+// wrapping, so a pathologically high-cardinality family is reported as
+// "huge" rather than silently wrapping around to a small number and
+// dropping out of the Offenders top-K.
+func (f *familyMeta) cardinality() uint64 {
+	var product uint64 = 1
+	for _, values := range f.labelValues {
+		n := uint64(len(values))
+		if n == 0 {
+			continue
+		}
+		if product > math.MaxUint64/n {
+			return math.MaxUint64
+		}
+		product *= n
+	}
+	return product
+}
+
+// buildLabelStats turns the per-family label bookkeeping collected during a
+// scan into the public LabelStat and Offender slices.
+func buildLabelStats(families map[string]*familyMeta, opts Options) ([]LabelStat, []Offender) {
+	labelStats := make(map[string]*labelMeta)
+
+	for familyName, f := range families {
+		for labelName, values := range f.labelValues {
+			lm, ok := labelStats[labelName]
+			if !ok {
+				lm = newLabelMeta()
+				labelStats[labelName] = lm
+			}
+			for v := range values {
+				lm.values[v] = struct{}{}
+			}
+			lm.familyCounts[familyName] += len(values)
+		}
+	}
+
+	labels := make([]LabelStat, 0, len(labelStats))
+	for name, lm := range labelStats {
+		type contribution struct {
+			family string
+			count  int
+		}
+		contributions := make([]contribution, 0, len(lm.familyCounts))
+		for family, count := range lm.familyCounts {
+			contributions = append(contributions, contribution{family, count})
+		}
+		sort.Slice(contributions, func(i, j int) bool {
+			return contributions[i].count > contributions[j].count
+		})
+
+		top := make([]string, 0, 3)
+		for i := 0; i < len(contributions) && i < 3; i++ {
+			top = append(top, contributions[i].family)
+		}
+
+		labels = append(labels, LabelStat{
+			Name:           name,
+			FamilyCount:    len(lm.familyCounts),
+			DistinctValues: len(lm.values),
+			TopFamilies:    top,
+		})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+	threshold := uint64(opts.threshold())
+	offenders := make([]Offender, 0)
+	for name, f := range families {
+		if c := f.cardinality(); c > threshold {
+			offenders = append(offenders, Offender{Family: name, Cardinality: c})
+		}
+	}
+	sort.Slice(offenders, func(i, j int) bool { return offenders[i].Cardinality > offenders[j].Cardinality })
+	if k := opts.topK(); len(offenders) > k {
+		offenders = offenders[:k]
+	}
+
+	return labels, offenders
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package targetstats
+
+import (
+	"math"
+	"testing"
+)
+
+func valueSet(values ...string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
+func TestFamilyMetaCardinality(t *testing.T) {
+	t.Run("multiplies distinct value counts across labels", func(t *testing.T) {
+		f := newFamilyMeta()
+		f.labelValues["a"] = valueSet("1", "2")
+		f.labelValues["b"] = valueSet("x", "y", "z")
+		if got, want := f.cardinality(), uint64(6); got != want {
+			t.Errorf("cardinality() = %d, want %d", got, want)
+		}
+	})
+
+	t.Run("saturates instead of wrapping on overflow", func(t *testing.T) {
+		f := newFamilyMeta()
+		// 100^10 overflows uint64 (max ~1.8e19, 100^10 = 1e20).
+		for i := 0; i < 10; i++ {
+			values := make(map[string]struct{}, 100)
+			for v := 0; v < 100; v++ {
+				values[string(rune(v))] = struct{}{}
+			}
+			f.labelValues[string(rune('a'+i))] = values
+		}
+		if got := f.cardinality(); got != math.MaxUint64 {
+			t.Errorf("cardinality() = %d, want saturated %d", got, uint64(math.MaxUint64))
+		}
+	})
+
+	t.Run("empty family has cardinality one", func(t *testing.T) {
+		f := newFamilyMeta()
+		if got, want := f.cardinality(), uint64(1); got != want {
+			t.Errorf("cardinality() = %d, want %d", got, want)
+		}
+	})
+}
+
+func TestBuildLabelStats(t *testing.T) {
+	families := map[string]*familyMeta{
+		"http_requests_total": {
+			labelValues: map[string]map[string]struct{}{
+				"method": valueSet("get", "post"),
+				"path":   valueSet("/a", "/b", "/c"),
+			},
+		},
+		"http_request_duration_seconds": {
+			labelValues: map[string]map[string]struct{}{
+				"method": valueSet("get"),
+			},
+		},
+	}
+
+	labels, offenders := buildLabelStats(families, Options{Threshold: 2, TopK: 10})
+
+	byName := make(map[string]LabelStat, len(labels))
+	for _, l := range labels {
+		byName[l.Name] = l
+	}
+
+	method, ok := byName["method"]
+	if !ok {
+		t.Fatalf("expected a LabelStat for %q", "method")
+	}
+	if method.FamilyCount != 2 {
+		t.Errorf("method.FamilyCount = %d, want 2", method.FamilyCount)
+	}
+	if method.DistinctValues != 2 {
+		t.Errorf("method.DistinctValues = %d, want 2", method.DistinctValues)
+	}
+
+	path, ok := byName["path"]
+	if !ok {
+		t.Fatalf("expected a LabelStat for %q", "path")
+	}
+	if path.FamilyCount != 1 || path.DistinctValues != 3 {
+		t.Errorf("path = %+v, want FamilyCount=1 DistinctValues=3", path)
+	}
+
+	// http_requests_total has cardinality 2*3=6 > threshold 2.
+	// http_request_duration_seconds has cardinality 1, below threshold.
+	if len(offenders) != 1 || offenders[0].Family != "http_requests_total" {
+		t.Errorf("offenders = %+v, want exactly http_requests_total", offenders)
+	}
+	if offenders[0].Cardinality != 6 {
+		t.Errorf("offenders[0].Cardinality = %d, want 6", offenders[0].Cardinality)
+	}
+}
+
+func TestBuildLabelStatsTopK(t *testing.T) {
+	families := make(map[string]*familyMeta)
+	for i := 0; i < 5; i++ {
+		families[string(rune('a'+i))] = &familyMeta{
+			labelValues: map[string]map[string]struct{}{
+				"l": valueSet("1", "2", "3"),
+			},
+		}
+	}
+
+	_, offenders := buildLabelStats(families, Options{Threshold: 1, TopK: 2})
+	if len(offenders) != 2 {
+		t.Fatalf("len(offenders) = %d, want 2 (TopK)", len(offenders))
+	}
+}
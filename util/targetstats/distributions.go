@@ -0,0 +1,120 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package targetstats
+
+import (
+	"math"
+
+	"github.com/beorn7/perks/quantile"
+)
+
+// maxDistributionSamples bounds how many samples feed a family's quantile
+// sketch. Once reached, the sketch is frozen so a pathological exporter
+// cannot grow memory unboundedly.
+const maxDistributionSamples = 10000
+
+// distributionTargets are the quantiles tracked for every family, paired
+// with their acceptable rank error, as expected by quantile.NewTargeted.
+var distributionTargets = map[float64]float64{
+	0.5:  0.05,
+	0.9:  0.01,
+	0.99: 0.001,
+}
+
+// DistributionStat reports a streaming quantile summary of the observed
+// sample values for a metric family.
+type DistributionStat struct {
+	Family string
+	Count  int
+	Min    float64
+	Max    float64
+	P50    float64
+	P90    float64
+	P99    float64
+	// NonFinite counts samples that were NaN or +/-Inf and were excluded
+	// from the sketch and the Min/Max/quantile calculations above.
+	NonFinite int
+}
+
+// distributionMeta accumulates a bounded quantile sketch for a single
+// family's observed sample values.
+type distributionMeta struct {
+	stream    *quantile.Stream
+	count     int
+	min       float64
+	max       float64
+	frozen    bool
+	nonFinite int
+}
+
+func newDistributionMeta() *distributionMeta {
+	return &distributionMeta{
+		stream: quantile.NewTargeted(distributionTargets),
+		min:    math.Inf(1),
+		max:    math.Inf(-1),
+	}
+}
+
+// observe feeds v into the sketch, unless the family has already reached
+// maxDistributionSamples. NaN and +/-Inf samples (legitimate in exposition
+// data, e.g. a gauge reporting "no value") are counted separately instead of
+// being inserted: the CKM sketch assumes a total order over its inputs, and
+// Min/Max sentinels would otherwise get stuck at +Inf/-Inf forever.
+func (d *distributionMeta) observe(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		d.nonFinite++
+		return
+	}
+
+	if d.frozen {
+		return
+	}
+
+	d.stream.Insert(v)
+	d.count++
+	if v < d.min {
+		d.min = v
+	}
+	if v > d.max {
+		d.max = v
+	}
+	if d.count >= maxDistributionSamples {
+		d.frozen = true
+	}
+}
+
+func (d *distributionMeta) stat(family string) DistributionStat {
+	return DistributionStat{
+		Family:    family,
+		Count:     d.count,
+		Min:       d.min,
+		Max:       d.max,
+		P50:       d.stream.Query(0.5),
+		P90:       d.stream.Query(0.9),
+		P99:       d.stream.Query(0.99),
+		NonFinite: d.nonFinite,
+	}
+}
+
+// distributionTracked reports whether a family's raw sample values are
+// worth sketching. Histograms and summaries expose bucket boundaries and
+// pre-computed quantiles rather than raw observations, so they are skipped.
+func distributionTracked(familyType string) bool {
+	switch familyType {
+	case "histogram", "summary":
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package targetstats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistributionMetaObserve(t *testing.T) {
+	d := newDistributionMeta()
+	for _, v := range []float64{1, 2, 3, 4, 5} {
+		d.observe(v)
+	}
+
+	stat := d.stat("foo")
+	if stat.Count != 5 {
+		t.Errorf("Count = %d, want 5", stat.Count)
+	}
+	if stat.Min != 1 {
+		t.Errorf("Min = %v, want 1", stat.Min)
+	}
+	if stat.Max != 5 {
+		t.Errorf("Max = %v, want 5", stat.Max)
+	}
+	if stat.NonFinite != 0 {
+		t.Errorf("NonFinite = %d, want 0", stat.NonFinite)
+	}
+}
+
+func TestDistributionMetaSkipsNonFinite(t *testing.T) {
+	d := newDistributionMeta()
+	d.observe(1)
+	d.observe(math.NaN())
+	d.observe(math.Inf(1))
+	d.observe(math.Inf(-1))
+	d.observe(9)
+
+	stat := d.stat("foo")
+	if stat.Count != 2 {
+		t.Errorf("Count = %d, want 2 (NaN/Inf samples excluded)", stat.Count)
+	}
+	if stat.NonFinite != 3 {
+		t.Errorf("NonFinite = %d, want 3", stat.NonFinite)
+	}
+	if stat.Min != 1 {
+		t.Errorf("Min = %v, want 1 (not stuck at +Inf sentinel)", stat.Min)
+	}
+	if stat.Max != 9 {
+		t.Errorf("Max = %v, want 9 (not stuck at -Inf sentinel)", stat.Max)
+	}
+}
+
+func TestDistributionMetaFreezesAtCap(t *testing.T) {
+	d := newDistributionMeta()
+	for i := 0; i < maxDistributionSamples+100; i++ {
+		d.observe(float64(i))
+	}
+
+	if !d.frozen {
+		t.Error("expected sketch to be frozen after exceeding maxDistributionSamples")
+	}
+	if d.count != maxDistributionSamples {
+		t.Errorf("count = %d, want %d (frozen at cap)", d.count, maxDistributionSamples)
+	}
+
+	// Once frozen, finite observations are no-ops, while non-finite ones
+	// are still counted.
+	d.observe(math.NaN())
+	if d.nonFinite != 1 {
+		t.Errorf("nonFinite = %d, want 1 (still counted even while frozen)", d.nonFinite)
+	}
+	d.observe(42)
+	if d.count != maxDistributionSamples {
+		t.Errorf("count = %d, want unchanged %d after freeze", d.count, maxDistributionSamples)
+	}
+}
+
+func TestDistributionTracked(t *testing.T) {
+	cases := map[string]bool{
+		"counter":   true,
+		"gauge":     true,
+		"untyped":   true,
+		"":          true,
+		"histogram": false,
+		"summary":   false,
+	}
+	for typ, want := range cases {
+		if got := distributionTracked(typ); got != want {
+			t.Errorf("distributionTracked(%q) = %v, want %v", typ, got, want)
+		}
+	}
+}
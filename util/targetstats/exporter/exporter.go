@@ -0,0 +1,133 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exporter runs a targetstats.TargetAnalyzer as a long-running
+// Prometheus exporter: each request to the handler scrapes and analyzes the
+// target named by the "target" query parameter and renders the resulting
+// TargetStats as a fresh set of metrics, following the multi-target pattern
+// used by exporters such as blackbox_exporter.
+package exporter
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/prometheus/prometheus/util/targetstats"
+)
+
+// Handler scrapes and analyzes a target on every request and exposes the
+// result in the Prometheus exposition format.
+type Handler struct {
+	ScrapeOptions  targetstats.ScrapeOptions
+	AnalyzeOptions targetstats.Options
+}
+
+// NewHandler creates a Handler that scrapes targets with scrapeOpts and
+// analyzes them with analyzeOpts.
+func NewHandler(scrapeOpts targetstats.ScrapeOptions, analyzeOpts targetstats.Options) *Handler {
+	return &Handler{
+		ScrapeOptions:  scrapeOpts,
+		AnalyzeOptions: analyzeOpts,
+	}
+}
+
+// ServeHTTP implements http.Handler. It requires a "target" query parameter
+// naming the URL to scrape and analyze.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+
+	scrapeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "targetstats_scrape_duration_seconds",
+		Help: "Time in seconds taken to scrape and analyze the target.",
+	})
+	scrapeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "targetstats_scrape_success",
+		Help: "Whether the scrape and analysis of the target succeeded (1) or not (0).",
+	})
+	registry.MustRegister(scrapeDuration, scrapeSuccess)
+
+	start := time.Now()
+	stats, err := targetstats.NewFromURL(target, h.ScrapeOptions).Analyze(h.AnalyzeOptions)
+	scrapeDuration.Set(time.Since(start).Seconds())
+
+	if err != nil {
+		scrapeSuccess.Set(0)
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+		return
+	}
+	scrapeSuccess.Set(1)
+
+	registerStats(registry, stats)
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// entryKinds are the stats.Generic names that count textparse entries by
+// kind, plus the exemplars read off series entries. stats.Generic also carries the unrelated
+// "created_series_count" and "unit_<unit>_count" tallies (see chunk0-1),
+// which must not leak into targetstats_entry_count{kind=...}.
+var entryKinds = map[string]bool{
+	"Type_count":     true,
+	"Help_count":     true,
+	"Series_count":   true,
+	"Comment_count":  true,
+	"Unit_count":     true,
+	"Exemplar_count": true,
+}
+
+// registerStats translates stats into Prometheus collectors and registers
+// them with registry.
+func registerStats(registry *prometheus.Registry, stats targetstats.TargetStats) {
+	entryCount := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "targetstats_entry_count",
+		Help: "Number of exposition entries seen on the target, by kind.",
+	}, []string{"kind"})
+	for _, s := range stats.Generic {
+		if !entryKinds[s.Name] {
+			continue
+		}
+		entryCount.WithLabelValues(strings.TrimSuffix(s.Name, "_count")).Set(s.Value)
+	}
+
+	familySeriesCount := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "targetstats_family_series_count",
+		Help: "Number of series belonging to a metric family.",
+	}, []string{"family"})
+	familyCardinality := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "targetstats_family_cardinality",
+		Help: "Cartesian product of per-label distinct value counts for a metric family.",
+	}, []string{"family"})
+	for _, f := range stats.Families {
+		familySeriesCount.WithLabelValues(f.Name).Set(float64(f.SeriesCount))
+		familyCardinality.WithLabelValues(f.Name).Set(float64(f.Cardinality))
+	}
+
+	labelCardinality := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "targetstats_label_cardinality",
+		Help: "Number of distinct values observed for a label name across the target.",
+	}, []string{"label"})
+	for _, l := range stats.Labels {
+		labelCardinality.WithLabelValues(l.Name).Set(float64(l.DistinctValues))
+	}
+
+	registry.MustRegister(entryCount, familySeriesCount, familyCardinality, labelCardinality)
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/util/targetstats"
+)
+
+const exampleTarget = `# HELP http_requests_total Total HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get"} 1
+http_requests_total_created 1620000000.000
+# HELP response_size_bytes Size of the HTTP response.
+# TYPE response_size_bytes gauge
+# UNIT response_size_bytes bytes
+response_size_bytes 2
+# EOF
+`
+
+func TestHandlerServeHTTPRequiresTarget(t *testing.T) {
+	h := NewHandler(targetstats.ScrapeOptions{}, targetstats.Options{})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandlerServeHTTPEntryCountExcludesNonEntryTallies(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(exampleTarget))
+	}))
+	defer target.Close()
+
+	h := NewHandler(targetstats.ScrapeOptions{}, targetstats.Options{})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/?target="+target.URL, nil)
+
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d, body: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	body := rec.Body.String()
+	for _, bogus := range []string{
+		`targetstats_entry_count{kind="created_series"}`,
+		`targetstats_entry_count{kind="unit_bytes"}`,
+	} {
+		if strings.Contains(body, bogus) {
+			t.Errorf("response unexpectedly contains %q:\n%s", bogus, body)
+		}
+	}
+	if !strings.Contains(body, `targetstats_entry_count{kind="Series"}`) {
+		t.Errorf("response missing expected targetstats_entry_count{kind=\"Series\"}:\n%s", body)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package targetstats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// acceptHeader is sent on every scrape performed by NewFromURL. It prefers
+// OpenMetrics, falling back to the classic Prometheus text format, mirroring
+// what the Prometheus scraper itself negotiates.
+const acceptHeader = "application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.4"
+
+// defaultMaxRedirects bounds how many redirects a scrape will follow when
+// ScrapeOptions.MaxRedirects is left unset.
+const defaultMaxRedirects = 10
+
+// defaultRetryBackoff is the delay between retries when
+// ScrapeOptions.RetryBackoff is left unset.
+const defaultRetryBackoff = 500 * time.Millisecond
+
+// ScrapeOptions configures a scrape performed by NewFromURL.
+type ScrapeOptions struct {
+	// Timeout bounds the whole scrape, including redirects and retries.
+	// Zero means no timeout.
+	Timeout time.Duration
+	// MaxRedirects bounds how many redirects are followed before the
+	// scrape is aborted. Defaults to defaultMaxRedirects when zero.
+	MaxRedirects int
+	// Retries is how many additional attempts are made if the scrape
+	// fails at the network level (connection refused/reset, timeout).
+	// HTTP error status codes are not retried, since TargetStats.Scrape
+	// reports them for the caller to inspect. Zero means no retries.
+	Retries int
+	// RetryBackoff is the delay between retries. Defaults to
+	// defaultRetryBackoff when zero and Retries > 0.
+	RetryBackoff time.Duration
+	// BearerToken, if set, is sent as an "Authorization: Bearer" header
+	// and takes precedence over Username/Password.
+	BearerToken string
+	// Username and Password, if set, are sent as HTTP basic auth.
+	Username string
+	Password string
+}
+
+func (o ScrapeOptions) maxRedirects() int {
+	if o.MaxRedirects > 0 {
+		return o.MaxRedirects
+	}
+	return defaultMaxRedirects
+}
+
+func (o ScrapeOptions) retryBackoff() time.Duration {
+	if o.RetryBackoff > 0 {
+		return o.RetryBackoff
+	}
+	return defaultRetryBackoff
+}
+
+// scrapeResult records network-level observations about a scrape performed
+// by NewFromURL, surfaced as TargetStats.Scrape.
+type scrapeResult struct {
+	statusCode      int
+	duration        time.Duration
+	bytesRead       int
+	compressed      bool
+	compressedBytes int64
+}
+
+// doWithRetry performs req, retrying up to opts.Retries times on network-level
+// failures (req has no body, so it is safe to resend as-is). HTTP responses,
+// even error ones, are returned immediately without retrying. req's context
+// deadline (set by NewFromURL to opts.Timeout) bounds every attempt and the
+// backoff sleeps between them, so the worst case wall-clock stays at
+// opts.Timeout regardless of opts.Retries.
+func doWithRetry(client *http.Client, req *http.Request, opts ScrapeOptions) (*http.Response, error) {
+	var resp *http.Response
+	var err error
+
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(opts.retryBackoff()):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+		resp, err = client.Do(req)
+		if err == nil {
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// NewFromURL scrapes url according to opts and returns a TargetAnalyzer over
+// the (decompressed) response body. Unlike New, the scrape happens eagerly:
+// any network error is recorded and surfaced by the first call to Analyze
+// rather than returned here, matching how New defers parse errors to
+// Analyze as well.
+func NewFromURL(url string, opts ScrapeOptions) *TargetAnalyzer {
+	start := time.Now()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.maxRedirects() {
+				return fmt.Errorf("stopped after %d redirects", opts.maxRedirects())
+			}
+			return nil
+		},
+	}
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &TargetAnalyzer{scrapeErr: err}
+	}
+	req.Header.Set("Accept", acceptHeader)
+	req.Header.Set("Accept-Encoding", "gzip")
+	switch {
+	case opts.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+opts.BearerToken)
+	case opts.Username != "":
+		req.SetBasicAuth(opts.Username, opts.Password)
+	}
+
+	resp, err := doWithRetry(client, req, opts)
+	if err != nil {
+		return &TargetAnalyzer{scrapeErr: err}
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	compressed := resp.Header.Get("Content-Encoding") == "gzip"
+	if compressed {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return &TargetAnalyzer{scrapeErr: err}
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return &TargetAnalyzer{scrapeErr: err}
+	}
+
+	return &TargetAnalyzer{
+		r:           bytes.NewReader(b),
+		format:      FormatAuto,
+		contentType: resp.Header.Get("Content-Type"),
+		scrape: &scrapeResult{
+			statusCode:      resp.StatusCode,
+			duration:        time.Since(start),
+			bytesRead:       len(b),
+			compressed:      compressed,
+			compressedBytes: resp.ContentLength,
+		},
+	}
+}
+
+// statsFor turns the recorded scrape observations into the Scrape section of
+// TargetStats. Returns nil if the analyzer was not created via NewFromURL.
+func (s *scrapeResult) statsFor() []TargetStat {
+	if s == nil {
+		return nil
+	}
+
+	stats := []TargetStat{
+		{Name: "status_code", Value: float64(s.statusCode)},
+		{Name: "duration_seconds", Value: s.duration.Seconds()},
+		{Name: "bytes_read", Value: float64(s.bytesRead)},
+	}
+
+	if s.compressed && s.compressedBytes > 0 {
+		stats = append(stats, TargetStat{
+			Name:  "decompressed_ratio",
+			Value: float64(s.bytesRead) / float64(s.compressedBytes),
+		})
+	}
+
+	return stats
+}
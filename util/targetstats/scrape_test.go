@@ -0,0 +1,145 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package targetstats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewFromURLGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("foo_total 1\n"))
+	gz.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	ta := NewFromURL(srv.URL, ScrapeOptions{})
+	if ta.scrapeErr != nil {
+		t.Fatalf("unexpected scrapeErr: %v", ta.scrapeErr)
+	}
+
+	body, err := ioutil.ReadAll(ta.r)
+	if err != nil {
+		t.Fatalf("reading analyzer body: %v", err)
+	}
+	if string(body) != "foo_total 1\n" {
+		t.Errorf("body = %q, want decompressed %q", body, "foo_total 1\n")
+	}
+	if !ta.scrape.compressed {
+		t.Error("scrape.compressed = false, want true")
+	}
+}
+
+func TestNewFromURLRedirectLimit(t *testing.T) {
+	var mux http.ServeMux
+	srv := httptest.NewServer(&mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/start", http.StatusFound)
+	})
+
+	ta := NewFromURL(srv.URL+"/start", ScrapeOptions{MaxRedirects: 2})
+	if ta.scrapeErr == nil {
+		t.Fatal("expected scrapeErr after exceeding MaxRedirects, got nil")
+	}
+}
+
+func TestNewFromURLAuth(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte("foo_total 1\n"))
+	}))
+	defer srv.Close()
+
+	NewFromURL(srv.URL, ScrapeOptions{BearerToken: "secret"})
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization header = %q, want %q", gotAuth, "Bearer secret")
+	}
+
+	NewFromURL(srv.URL, ScrapeOptions{Username: "user", Password: "pass"})
+	if !strings.HasPrefix(gotAuth, "Basic ") {
+		t.Errorf("Authorization header = %q, want Basic auth", gotAuth)
+	}
+}
+
+func TestNewFromURLRetriesOnNetworkFailure(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			// Simulate a network-level failure by closing the connection
+			// without a response.
+			hj, ok := w.(http.Hijacker)
+			if !ok {
+				t.Fatal("ResponseWriter does not support hijacking")
+			}
+			conn, _, err := hj.Hijack()
+			if err != nil {
+				t.Fatalf("hijack: %v", err)
+			}
+			conn.Close()
+			return
+		}
+		w.Write([]byte("foo_total 1\n"))
+	}))
+	defer srv.Close()
+
+	ta := NewFromURL(srv.URL, ScrapeOptions{Retries: 3, RetryBackoff: time.Millisecond})
+	if ta.scrapeErr != nil {
+		t.Fatalf("unexpected scrapeErr after retries: %v", ta.scrapeErr)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+}
+
+func TestNewFromURLTimeoutBoundsAllRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("foo_total 1\n"))
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	ta := NewFromURL(srv.URL, ScrapeOptions{
+		Timeout:      20 * time.Millisecond,
+		Retries:      5,
+		RetryBackoff: 20 * time.Millisecond,
+	})
+	elapsed := time.Since(start)
+
+	if ta.scrapeErr == nil {
+		t.Fatal("expected scrapeErr from exceeding Timeout, got nil")
+	}
+	// With the old per-attempt Client.Timeout, 6 attempts at ~20ms each
+	// plus 5 backoffs of 20ms could take ~220ms. The shared deadline
+	// should cut this off after ~20ms, well before that.
+	if elapsed > 200*time.Millisecond {
+		t.Errorf("elapsed = %v, want under 200ms (per-attempt timeouts plus backoffs would take ~220ms)", elapsed)
+	}
+}
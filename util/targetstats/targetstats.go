@@ -15,6 +15,7 @@
 package targetstats
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -22,13 +23,41 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/prometheus/prometheus/pkg/exemplar"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/textparse"
 )
 
+// Format identifies the exposition format a target's response is encoded in.
+type Format string
+
+const (
+	// FormatPromText parses the input as the classic Prometheus text format.
+	FormatPromText Format = "text"
+	// FormatOpenMetrics parses the input as OpenMetrics, including exemplars,
+	// "_created" series and the "# EOF" marker.
+	FormatOpenMetrics Format = "openmetrics"
+	// FormatAuto sniffs the input (and, when available, the scrape's
+	// Content-Type) to decide between FormatPromText and FormatOpenMetrics.
+	FormatAuto Format = "auto"
+)
+
+// openMetricsContentType is the Content-Type exporters use to advertise
+// OpenMetrics output, as negotiated via the Accept header.
+const openMetricsContentType = "application/openmetrics-text"
+
 // A TargetAnalyzer is a Prometheus target statistics interface. It computes stats
 // about a prometheus target and reports them to the caller.
 type TargetAnalyzer struct {
-	r io.Reader
+	r           io.Reader
+	format      Format
+	contentType string
+
+	// scrape and scrapeErr are set when the analyzer was created via
+	// NewFromURL; scrapeErr short-circuits Analyze with the network error
+	// encountered during the scrape.
+	scrape    *scrapeResult
+	scrapeErr error
 }
 
 type TargetStat struct {
@@ -37,33 +66,181 @@ type TargetStat struct {
 }
 
 type TargetStats struct {
-	Generic []TargetStat
-	Types   []TargetStat
-	Series  []TargetStat
+	Generic       []TargetStat
+	Types         []TargetStat
+	Series        []TargetStat
+	Exemplars     []TargetStat
+	Families      []FamilyStat
+	Labels        []LabelStat
+	Offenders     []Offender
+	Scrape        []TargetStat
+	Distributions []DistributionStat
+}
+
+// FamilyStat reports aggregated statistics for a single metric family, i.e.
+// a TYPE-declared metric name and every series belonging to it (the
+// `_bucket` series of a histogram, the `_sum` and `_count` series of a
+// histogram or summary, and the `_created` series of any family).
+type FamilyStat struct {
+	Name        string
+	Type        string
+	SeriesCount int
+	BucketCount int
+	// Cardinality is the cartesian product of the family's per-label
+	// distinct value counts, i.e. the same number reported for this
+	// family in Offenders, regardless of whether it crossed the
+	// Options.Threshold there.
+	Cardinality uint64
+	MissingHelp bool
+	MissingType bool
+	MissingUnit bool
+}
+
+// familyMeta accumulates per-family bookkeeping while the target is scanned.
+type familyMeta struct {
+	typ         string
+	hasHelp     bool
+	hasType     bool
+	hasUnit     bool
+	seriesCount int
+	bucketCount int
+	labelValues map[string]map[string]struct{}
+}
+
+func newFamilyMeta() *familyMeta {
+	return &familyMeta{
+		labelValues: make(map[string]map[string]struct{}),
+	}
+}
+
+// recordLabels folds lbls into the family's per-label value sets, ignoring
+// the synthetic "__name__" label.
+func (f *familyMeta) recordLabels(lbls labels.Labels) {
+	for _, lbl := range lbls {
+		if lbl.Name == labels.MetricName {
+			continue
+		}
+		values, ok := f.labelValues[lbl.Name]
+		if !ok {
+			values = make(map[string]struct{})
+			f.labelValues[lbl.Name] = values
+		}
+		values[lbl.Value] = struct{}{}
+	}
+}
+
+// familyNameFor maps a raw series name to the metric family it belongs to,
+// folding `_bucket` series of histograms, `_sum` and `_count` series of
+// histograms and summaries, and `_created` series of any known family (for
+// example a counter) back onto the parent name. Series for which no such
+// parent is known (including plain counters and gauges themselves) are their
+// own family.
+func familyNameFor(series string, families map[string]*familyMeta) string {
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_created"} {
+		if !strings.HasSuffix(series, suffix) {
+			continue
+		}
+		base := strings.TrimSuffix(series, suffix)
+		m, ok := families[base]
+		if !ok {
+			continue
+		}
+		switch suffix {
+		case "_bucket":
+			if m.typ == "histogram" {
+				return base
+			}
+		case "_created":
+			return base
+		default: // _sum, _count
+			if m.typ == "histogram" || m.typ == "summary" {
+				return base
+			}
+		}
+	}
+	return series
 }
 
 // New creates a new TargetAnalyzer that reads an input stream of Prometheus target.
+// The input is assumed to be the classic Prometheus text format; use
+// NewWithFormat to analyze OpenMetrics targets.
 func New(r io.Reader) *TargetAnalyzer {
+	return NewWithFormat(r, FormatPromText)
+}
+
+// NewWithFormat creates a new TargetAnalyzer that reads an input stream of
+// target data encoded as format. Pass FormatAuto to have the analyzer sniff
+// the input itself.
+func NewWithFormat(r io.Reader, format Format) *TargetAnalyzer {
 	return &TargetAnalyzer{
-		r: r,
+		r:      r,
+		format: format,
+	}
+}
+
+// resolveFormat returns the parser format to use for b, resolving FormatAuto
+// by inspecting contentType (when set) and falling back to sniffing the body
+// for the OpenMetrics "# EOF" trailer.
+func resolveFormat(format Format, contentType string, b []byte) Format {
+	if format != FormatAuto {
+		return format
+	}
+
+	if strings.Contains(contentType, openMetricsContentType) {
+		return FormatOpenMetrics
+	}
+
+	if bytes.Contains(b, []byte("\n# EOF")) || bytes.HasPrefix(bytes.TrimSpace(b), []byte("# EOF")) {
+		return FormatOpenMetrics
+	}
+
+	return FormatPromText
+}
+
+func newParser(format Format, contentType string, b []byte) textparse.Parser {
+	switch resolveFormat(format, contentType, b) {
+	case FormatOpenMetrics:
+		return textparse.NewOpenMetricsParser(b)
+	default:
+		return textparse.NewPromParser(b)
 	}
 }
 
 // Analyze performs a statistics analysis on the target, returning statistics
-// about metrics/labels found in the exporter data
-func (l *TargetAnalyzer) Analyze(sortBy string) (TargetStats, error) {
+// about metrics/labels found in the exporter data. opts controls sort order
+// and the label-cardinality offender report.
+func (l *TargetAnalyzer) Analyze(opts Options) (TargetStats, error) {
 	stats := TargetStats{}
 
+	if l.scrapeErr != nil {
+		return stats, l.scrapeErr
+	}
+	stats.Scrape = l.scrape.statsFor()
+
 	typeStats := make(map[string]int)
 	genericStats := make(map[string]int)
 	serieStats := make(map[string]int)
+	exemplarStats := make(map[string]int)
+	unitStats := make(map[string]int)
+	families := make(map[string]*familyMeta)
+	distributions := make(map[string]*distributionMeta)
+	createdSeries := 0
+
+	family := func(name string) *familyMeta {
+		f, ok := families[name]
+		if !ok {
+			f = newFamilyMeta()
+			families[name] = f
+		}
+		return f
+	}
 
 	b, err := ioutil.ReadAll(l.r)
 	if err != nil {
 		return stats, err
 	}
 
-	t := textparse.NewPromParser(b)
+	t := newParser(l.format, l.contentType, b)
 
 	for {
 		e, err := t.Next()
@@ -76,38 +253,86 @@ func (l *TargetAnalyzer) Analyze(sortBy string) (TargetStats, error) {
 			return stats, errors.New("Invalid entry during target parsing")
 
 		case textparse.EntryType:
-			_, metricType := t.Type()
+			metricName, metricType := t.Type()
 			// fmt.Println("Type", string(metricName), metricType)
 			typeStats[string(metricType)] += 1
 			genericStats["Type"] += 1
 
+			f := family(string(metricName))
+			f.hasType = true
+			f.typ = string(metricType)
+
 		case textparse.EntryHelp:
-			// metricName, metricHelp := t.Help()
+			metricName, _ := t.Help()
 			// fmt.Println("Help", string(metricName), string(metricHelp))
 			genericStats["Help"] += 1
 
+			family(string(metricName)).hasHelp = true
+
 		case textparse.EntrySeries:
-			metricSeries, _, _ := t.Series()
-			s := strings.ToLower(string(metricSeries))
+			metricSeries, _, value := t.Series()
+			full := string(metricSeries)
 
-			cutHere := strings.Index(s, "{")
+			// name keeps the original case of the metric, matching the
+			// keys family() is indexed under from EntryType/EntryHelp, so
+			// familyNameFor can actually find the TYPE-declared parent of
+			// a family whose name contains uppercase characters (legal
+			// per the exposition-format grammar). s is the lowercased,
+			// brace-stripped form that keys the per-series and exemplar
+			// stats and is used for the _created and _bucket suffix
+			// checks below.
+			cutHere := strings.Index(full, "{")
+			name := full
 			if cutHere != -1 {
-				s = string(s[:cutHere])
+				name = full[:cutHere]
+			}
+			s := strings.ToLower(name)
+
+			if strings.HasSuffix(s, "_created") {
+				createdSeries++
 			}
 
 			serieStats[s] += 1
 			genericStats["Series"] += 1
 
+			var lbls labels.Labels
+			t.Metric(&lbls)
+
+			fname := familyNameFor(name, families)
+			f := family(fname)
+			f.seriesCount++
+			f.recordLabels(lbls)
+			if strings.HasSuffix(s, "_bucket") && fname != name {
+				f.bucketCount++
+			}
+
+			if distributionTracked(f.typ) {
+				d, ok := distributions[fname]
+				if !ok {
+					d = newDistributionMeta()
+					distributions[fname] = d
+				}
+				d.observe(value)
+			}
+
+			var ex exemplar.Exemplar
+			if t.Exemplar(&ex) {
+				exemplarStats[s] += 1
+				genericStats["Exemplar"] += 1
+			}
+
 		case textparse.EntryComment:
 			// fmt.Println("Comment", string(t.Comment()))
 			// statsTable["Series"] += 1
 			genericStats["Comment"] += 1
 
 		case textparse.EntryUnit:
-			// metricName, metricUnit := t.Unit()
-			// fmt.Println("Unit", string(metricName), string(metricUnit))
+			metricName, metricUnit := t.Unit()
+			unitStats[string(metricUnit)] += 1
 			genericStats["Unit"] += 1
 
+			family(string(metricName)).hasUnit = true
+
 		default:
 			return stats, fmt.Errorf("Unknown entry type %d", e)
 		}
@@ -134,16 +359,68 @@ func (l *TargetAnalyzer) Analyze(sortBy string) (TargetStats, error) {
 		})
 	}
 
-	switch sortBy {
+	for n, s := range exemplarStats {
+		stats.Exemplars = append(stats.Exemplars, TargetStat{
+			Name:  fmt.Sprintf("%s_count", n),
+			Value: float64(s),
+		})
+	}
+
+	stats.Generic = append(stats.Generic, TargetStat{
+		Name:  "created_series_count",
+		Value: float64(createdSeries),
+	})
+
+	for n, s := range unitStats {
+		stats.Generic = append(stats.Generic, TargetStat{
+			Name:  fmt.Sprintf("unit_%s_count", n),
+			Value: float64(s),
+		})
+	}
+
+	for n, f := range families {
+		stats.Families = append(stats.Families, FamilyStat{
+			Name:        n,
+			Type:        f.typ,
+			SeriesCount: f.seriesCount,
+			BucketCount: f.bucketCount,
+			Cardinality: f.cardinality(),
+			MissingHelp: !f.hasHelp,
+			MissingType: !f.hasType,
+			MissingUnit: !f.hasUnit,
+		})
+	}
+
+	stats.Labels, stats.Offenders = buildLabelStats(families, opts)
+
+	for n, d := range distributions {
+		stats.Distributions = append(stats.Distributions, d.stat(n))
+	}
+
+	switch opts.SortBy {
 	case "value":
 		sort.Sort(ByValueDesc(stats.Generic))
 		sort.Sort(ByValueDesc(stats.Types))
 		sort.Sort(ByValueDesc(stats.Series))
+		sort.Sort(ByValueDesc(stats.Exemplars))
+		sort.Slice(stats.Families, func(i, j int) bool {
+			return stats.Families[i].SeriesCount > stats.Families[j].SeriesCount
+		})
+		sort.Slice(stats.Distributions, func(i, j int) bool {
+			return stats.Distributions[i].Count > stats.Distributions[j].Count
+		})
 
 	case "name":
 		sort.Sort(ByName(stats.Generic))
 		sort.Sort(ByName(stats.Types))
 		sort.Sort(ByName(stats.Series))
+		sort.Sort(ByName(stats.Exemplars))
+		sort.Slice(stats.Families, func(i, j int) bool {
+			return stats.Families[i].Name < stats.Families[j].Name
+		})
+		sort.Slice(stats.Distributions, func(i, j int) bool {
+			return stats.Distributions[i].Family < stats.Distributions[j].Family
+		})
 	}
 
 	return stats, nil
@@ -0,0 +1,95 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package targetstats
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFamilyNameFor(t *testing.T) {
+	families := map[string]*familyMeta{
+		"http_request_duration_seconds": {typ: "histogram"},
+		"rpc_duration_seconds":          {typ: "summary"},
+		"http_requests_total":           {typ: "counter"},
+		"queue_size":                    {typ: "gauge"},
+		"MyHistogram":                   {typ: "histogram"},
+	}
+
+	cases := []struct {
+		name   string
+		series string
+		want   string
+	}{
+		{"histogram bucket folds to parent", "http_request_duration_seconds_bucket", "http_request_duration_seconds"},
+		{"histogram sum folds to parent", "http_request_duration_seconds_sum", "http_request_duration_seconds"},
+		{"histogram count folds to parent", "http_request_duration_seconds_count", "http_request_duration_seconds"},
+		{"histogram created folds to parent", "http_request_duration_seconds_created", "http_request_duration_seconds"},
+		{"summary sum folds to parent", "rpc_duration_seconds_sum", "rpc_duration_seconds"},
+		{"summary count folds to parent", "rpc_duration_seconds_count", "rpc_duration_seconds"},
+		{"counter created folds to parent", "http_requests_total_created", "http_requests_total"},
+		{"counter itself is its own family", "http_requests_total", "http_requests_total"},
+		{"gauge with _bucket suffix does not fold (not a histogram)", "queue_size_bucket", "queue_size_bucket"},
+		{"gauge with _count suffix does not fold (not a histogram/summary)", "queue_size_count", "queue_size_count"},
+		{"unknown base is left untouched", "unknown_metric_bucket", "unknown_metric_bucket"},
+		{"mixed-case family name folds to its exact-case parent", "MyHistogram_bucket", "MyHistogram"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := familyNameFor(c.series, families); got != c.want {
+				t.Errorf("familyNameFor(%q) = %q, want %q", c.series, got, c.want)
+			}
+		})
+	}
+}
+
+const openMetricsSample = `# HELP http_requests_total Total HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{path="/"} 1 # {trace_id="abc123"} 1 1620000000.000
+http_requests_total_created 1620000000.000
+# HELP request_duration_seconds Request duration.
+# TYPE request_duration_seconds gauge
+# UNIT request_duration_seconds seconds
+request_duration_seconds 0.5
+# EOF
+`
+
+func statNamed(stats []TargetStat, name string) (TargetStat, bool) {
+	for _, s := range stats {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return TargetStat{}, false
+}
+
+func TestAnalyzeOpenMetrics(t *testing.T) {
+	stats, err := NewWithFormat(strings.NewReader(openMetricsSample), FormatOpenMetrics).Analyze(Options{})
+	if err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+
+	if s, ok := statNamed(stats.Exemplars, "http_requests_total_count"); !ok || s.Value != 1 {
+		t.Errorf("Exemplars[http_requests_total_count] = %v, %v, want 1, true", s, ok)
+	}
+
+	if s, ok := statNamed(stats.Generic, "created_series_count"); !ok || s.Value != 1 {
+		t.Errorf("Generic[created_series_count] = %v, %v, want 1, true", s, ok)
+	}
+
+	if s, ok := statNamed(stats.Generic, "unit_seconds_count"); !ok || s.Value != 1 {
+		t.Errorf("Generic[unit_seconds_count] = %v, %v, want 1, true", s, ok)
+	}
+}